@@ -0,0 +1,198 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ErrChecksumMismatch is returned when the bytes we wrote don't hash to the
+// digest the server advertised (or the one passed via -checksum).
+type ErrChecksumMismatch struct {
+	Algorithm string
+	Expected  string
+	Got       string
+}
+
+func (e ErrChecksumMismatch) Error() string {
+	return fmt.Sprintf("checksum mismatch (%s): expected %s, got %s", e.Algorithm, e.Expected, e.Got)
+}
+
+// hashFactories maps an algorithm name to a constructor for it, so new
+// digest kinds can be supported by adding an entry here.
+var hashFactories = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+	"crc32c": func() hash.Hash { return crc32.New(crc32.MakeTable(crc32.Castagnoli)) },
+}
+
+// newHash returns a fresh hash.Hash for algorithm, or an error if we don't
+// have a factory for it.
+func newHash(algorithm string) (hash.Hash, error) {
+	factory, ok := hashFactories[strings.ToLower(algorithm)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported checksum algorithm : %v", algorithm)
+	}
+
+	return factory(), nil
+}
+
+// serverDigest parses the integrity digest a server advertised for the file,
+// preferring the standard Digest header (RFC 3230, e.g.
+// "sha-256=<base64>") and falling back to Google's x-goog-hash
+// (e.g. "md5=..., crc32c=...").
+func serverDigest(headers http.Header) (algorithm, expectedHex string, ok bool) {
+	if d := headers.Get("Digest"); d != "" {
+		if algorithm, expectedHex, ok = parseDigestHeader(d); ok {
+			return algorithm, expectedHex, true
+		}
+	}
+
+	if d := headers.Get("x-goog-hash"); d != "" {
+		if algorithm, expectedHex, ok = parseGoogHashHeader(d); ok {
+			return algorithm, expectedHex, true
+		}
+	}
+
+	return "", "", false
+}
+
+// parseDigestHeader parses a single algorithm=value pair out of an RFC 3230
+// Digest header, preferring sha-256 when several are present.
+func parseDigestHeader(d string) (algorithm, expectedHex string, ok bool) {
+	preferred := []string{"sha-256", "sha-512", "sha-1", "md5"}
+
+	parts := strings.Split(d, ",")
+	found := map[string]string{}
+
+	for _, part := range parts {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		found[strings.ToLower(kv[0])] = kv[1]
+	}
+
+	for _, alg := range preferred {
+		if v, ok := found[alg]; ok {
+			if hx, err := base64ToHex(v); err == nil {
+				return strings.ReplaceAll(alg, "-", ""), hx, true
+			}
+		}
+	}
+
+	return "", "", false
+}
+
+// parseGoogHashHeader parses Google's "x-goog-hash: md5=..., crc32c=..."
+// header, preferring crc32c since that's the one GCS always sets.
+func parseGoogHashHeader(d string) (algorithm, expectedHex string, ok bool) {
+	parts := strings.Split(d, ",")
+	found := map[string]string{}
+
+	for _, part := range parts {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		found[strings.ToLower(kv[0])] = kv[1]
+	}
+
+	for _, alg := range []string{"crc32c", "md5"} {
+		if v, ok := found[alg]; ok {
+			if hx, err := base64ToHex(v); err == nil {
+				return alg, hx, true
+			}
+		}
+	}
+
+	return "", "", false
+}
+
+func base64ToHex(b64 string) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(b64)
+	if err != nil {
+		return "", fmt.Errorf("error decoding base64 digest : %v", err)
+	}
+
+	return hex.EncodeToString(raw), nil
+}
+
+// parseChecksumFlag parses the -checksum flag's "algorithm:hex" value, e.g.
+// "sha256:deadbeef...".
+func parseChecksumFlag(v string) (checksumConfig, error) {
+	parts := strings.SplitN(v, ":", 2)
+	if len(parts) != 2 {
+		return checksumConfig{}, fmt.Errorf("-checksum must be in algorithm:hex form, got : %v", v)
+	}
+
+	algorithm, expectedHex := strings.ToLower(parts[0]), parts[1]
+
+	if _, err := newHash(algorithm); err != nil {
+		return checksumConfig{}, err
+	}
+
+	return checksumConfig{algorithm: algorithm, expectedHex: expectedHex}, nil
+}
+
+// verifyChecksum compares h's accumulated digest against expectedHex,
+// returning ErrChecksumMismatch on a mismatch.
+func verifyChecksum(algorithm, expectedHex string, h hash.Hash) error {
+	gotHex := hex.EncodeToString(h.Sum(nil))
+
+	if !strings.EqualFold(gotHex, expectedHex) {
+		return ErrChecksumMismatch{Algorithm: algorithm, Expected: expectedHex, Got: gotHex}
+	}
+
+	return nil
+}
+
+// streamChecksum starts hashing the output file's bytes as they land rather
+// than waiting for every chunk to finish and re-reading the file
+// afterwards: it consumes sum.Stream() in its own goroutine, in parallel
+// with process()'s chunk downloads, so the hash has already caught up to
+// the last byte by the time process() is ready to check it. The returned
+// channel carries the single verification result.
+func (sum *summon) streamChecksum() <-chan error {
+	result := make(chan error, 1)
+
+	go func() {
+		result <- sum.verifyStreamedChecksum()
+	}()
+
+	return result
+}
+
+// verifyStreamedChecksum does the actual streaming hash + compare that
+// streamChecksum runs in the background.
+func (sum *summon) verifyStreamedChecksum() error {
+	h, err := newHash(sum.checksum.algorithm)
+	if err != nil {
+		return err
+	}
+
+	reader, err := sum.Stream()
+	if err != nil {
+		return fmt.Errorf("error opening output file for checksum verification : %v", err)
+	}
+	defer reader.Close()
+
+	if _, err := io.Copy(h, reader); err != nil {
+		return fmt.Errorf("error hashing output file : %v", err)
+	}
+
+	return verifyChecksum(sum.checksum.algorithm, sum.checksum.expectedHex, h)
+}
@@ -0,0 +1,104 @@
+package main
+
+import "testing"
+
+func TestParseDigestHeader(t *testing.T) {
+	cases := []struct {
+		name          string
+		header        string
+		wantAlgorithm string
+		wantHex       string
+		wantOK        bool
+	}{
+		{
+			name:          "sha-256 only",
+			header:        "sha-256=uU0nuZNNPgilLlLX2n2r+sSE7+N6U4DukIj3rOLvzek=",
+			wantAlgorithm: "sha256",
+			wantHex:       "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9",
+			wantOK:        true,
+		},
+		{
+			name:          "prefers sha-256 over md5",
+			header:        "md5=XrY7u+Ae7tCTyyK7j1rNww==, sha-256=uU0nuZNNPgilLlLX2n2r+sSE7+N6U4DukIj3rOLvzek=",
+			wantAlgorithm: "sha256",
+			wantHex:       "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9",
+			wantOK:        true,
+		},
+		{
+			name:   "unparseable value",
+			header: "sha-256=not-valid-base64!!!",
+			wantOK: false,
+		},
+		{
+			name:   "empty header",
+			header: "",
+			wantOK: false,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			algorithm, hex, ok := parseDigestHeader(c.header)
+			if ok != c.wantOK {
+				t.Fatalf("parseDigestHeader(%q) ok = %v, want %v", c.header, ok, c.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if algorithm != c.wantAlgorithm {
+				t.Errorf("parseDigestHeader(%q) algorithm = %q, want %q", c.header, algorithm, c.wantAlgorithm)
+			}
+			if hex != c.wantHex {
+				t.Errorf("parseDigestHeader(%q) hex = %q, want %q", c.header, hex, c.wantHex)
+			}
+		})
+	}
+}
+
+func TestParseGoogHashHeader(t *testing.T) {
+	cases := []struct {
+		name          string
+		header        string
+		wantAlgorithm string
+		wantHex       string
+		wantOK        bool
+	}{
+		{
+			name:          "prefers crc32c over md5",
+			header:        "crc32c=DUoRhQ==, md5=XrY7u+Ae7tCTyyK7j1rNww==",
+			wantAlgorithm: "crc32c",
+			wantHex:       "0d4a1185",
+			wantOK:        true,
+		},
+		{
+			name:          "md5 only",
+			header:        "md5=XrY7u+Ae7tCTyyK7j1rNww==",
+			wantAlgorithm: "md5",
+			wantHex:       "5eb63bbbe01eeed093cb22bb8f5acdc3",
+			wantOK:        true,
+		},
+		{
+			name:   "unparseable value",
+			header: "crc32c=not-valid-base64!!!",
+			wantOK: false,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			algorithm, hex, ok := parseGoogHashHeader(c.header)
+			if ok != c.wantOK {
+				t.Fatalf("parseGoogHashHeader(%q) ok = %v, want %v", c.header, ok, c.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if algorithm != c.wantAlgorithm {
+				t.Errorf("parseGoogHashHeader(%q) algorithm = %q, want %q", c.header, algorithm, c.wantAlgorithm)
+			}
+			if hex != c.wantHex {
+				t.Errorf("parseGoogHashHeader(%q) hex = %q, want %q", c.header, hex, c.wantHex)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// humanizeUnits are the binary (KiB/MiB/...) prefixes humanizeBytes and
+// humanizeSpeed step through.
+var humanizeUnits = []string{"", "Ki", "Mi", "Gi", "Ti"}
+
+// humanizeBytes formats n bytes as e.g. "12.3 MiB", picking the largest
+// unit that keeps the number above 1.
+func humanizeBytes(n int64) string {
+	return humanizeFloat(float64(n)) + "B"
+}
+
+// humanizeSpeed formats a bytes-per-second rate as e.g. "12.3 MiB/s".
+func humanizeSpeed(bytesPerSec float64) string {
+	return humanizeFloat(bytesPerSec) + "B/s"
+}
+
+func humanizeFloat(n float64) string {
+	i := 0
+	for n >= 1024 && i < len(humanizeUnits)-1 {
+		n /= 1024
+		i++
+	}
+
+	return fmt.Sprintf("%.1f %s", n, humanizeUnits[i])
+}
+
+// humanizeETA formats a remaining duration as e.g. "1m42s", or "--" when
+// there's not yet enough throughput history to estimate one.
+func humanizeETA(d time.Duration) string {
+	if d <= 0 {
+		return "--"
+	}
+
+	d = d.Round(time.Second)
+
+	h := d / time.Hour
+	d -= h * time.Hour
+	m := d / time.Minute
+	d -= m * time.Minute
+	s := d / time.Second
+
+	switch {
+	case h > 0:
+		return fmt.Sprintf("%dh%dm%ds", h, m, s)
+	case m > 0:
+		return fmt.Sprintf("%dm%ds", m, s)
+	default:
+		return fmt.Sprintf("%ds", s)
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// ManifestEntry is a single file to fetch as part of a multifile download.
+type ManifestEntry struct {
+	URL        string `json:"url"`
+	OutputPath string `json:"output_path"`
+}
+
+// Options configures a multifile download.
+type Options struct {
+	MaxConcurrentFiles int // how many files may be downloading at once
+	MaxConcurrency     int // global cap on in-flight range requests across every file
+}
+
+// Manager coordinates a multifile download. Every file's summon shares the
+// Manager's HTTP client budget rather than each one spawning its own
+// independent worker pool, but gets its own progress bar and its own stop
+// channel - chunk indices start at 0 within every file, so a shared
+// progressBar would let two files downloading at once stomp on each
+// other's p[0], p[1], ... entries.
+type Manager struct {
+	opts Options
+
+	// sem is weighted by chunk count: every in-flight range request across
+	// every file acquires weight 1, so 20 files x 5 chunks never exceeds
+	// opts.MaxConcurrency concurrent HTTP requests.
+	sem     *semaphore.Weighted
+	fileSem chan struct{} // bounds opts.MaxConcurrentFiles
+	stop    chan struct{} // closed once to broadcast a shutdown to every file, not sent-to
+
+	// client is shared by every file's summon rather than each one dialing
+	// out with its own http.Client, so the manifest download reuses one
+	// connection pool across the whole manifest.
+	client *http.Client
+}
+
+// NewManager builds a Manager with opts, filling in defaults for anything
+// left unset.
+func NewManager(opts Options) *Manager {
+	if opts.MaxConcurrency <= 0 {
+		opts.MaxConcurrency = MAX_CONN
+	}
+
+	if opts.MaxConcurrentFiles <= 0 {
+		opts.MaxConcurrentFiles = DEFAULT_CONN
+	}
+
+	return &Manager{
+		opts:    opts,
+		sem:     semaphore.NewWeighted(int64(opts.MaxConcurrency)),
+		fileSem: make(chan struct{}, opts.MaxConcurrentFiles),
+		stop:    make(chan struct{}),
+		client:  &http.Client{Timeout: 0},
+	}
+}
+
+// SummonManifest downloads every entry in entries in parallel, sharing a
+// global concurrency budget across all of them rather than letting each
+// file spawn its own independent worker pool.
+func SummonManifest(ctx context.Context, entries []ManifestEntry, opts Options) error {
+	return NewManager(opts).downloadAll(ctx, entries)
+}
+
+// parseManifest reads entries from r, which may be either a JSON array of
+// ManifestEntry or newline-separated "url\toutfile" pairs.
+func parseManifest(r io.Reader) ([]ManifestEntry, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading manifest : %v", err)
+	}
+
+	var entries []ManifestEntry
+	if err := json.Unmarshal(data, &entries); err == nil {
+		return entries, nil
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		parts := strings.SplitN(line, "\t", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("malformed manifest line, expected url\\toutfile : %q", line)
+		}
+
+		entries = append(entries, ManifestEntry{URL: parts[0], OutputPath: parts[1]})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error scanning manifest : %v", err)
+	}
+
+	return entries, nil
+}
+
+// downloadAll fans out entries up to m.opts.MaxConcurrentFiles at a time,
+// and returns the first error encountered (in manifest order). It always
+// waits for every already-dispatched file to actually finish - even when
+// ctx is cancelled partway through dispatching - rather than returning
+// while those goroutines are still writing to the output files and errs.
+func (m *Manager) downloadAll(ctx context.Context, entries []ManifestEntry) error {
+	wg := &sync.WaitGroup{}
+	errs := make([]error, len(entries))
+
+	var cancelled error
+
+	for i, entry := range entries {
+		select {
+		case m.fileSem <- struct{}{}:
+		case <-ctx.Done():
+			cancelled = ctx.Err()
+		}
+
+		if cancelled != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(i int, entry ManifestEntry) {
+			defer wg.Done()
+			defer func() { <-m.fileSem }()
+
+			errs[i] = m.downloadOne(ctx, entry)
+		}(i, entry)
+	}
+
+	wg.Wait()
+
+	if cancelled != nil {
+		return cancelled
+	}
+
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("error downloading %s : %v", entries[i].URL, err)
+		}
+	}
+
+	return nil
+}
+
+// downloadOne fetches a single manifest entry, reusing the Manager's shared
+// HTTP client budget instead of standing up an independent worker pool
+// per-file.
+func (m *Manager) downloadOne(ctx context.Context, entry ManifestEntry) error {
+	sum, err := newManifestSummon(ctx, entry, m)
+	if err != nil {
+		return err
+	}
+
+	return sum.process()
+}
+
+// newManifestSummon builds the summon for one manifest entry, wired up to
+// share its Manager's concurrency budget rather than getting its own. It
+// gets its own progressBar and stop channel - not the Manager's - so it
+// doesn't stomp on or get starved by any other file's.
+func newManifestSummon(ctx context.Context, entry ManifestEntry, m *Manager) (*summon, error) {
+	sum := new(summon)
+
+	sum.uri = entry.URL
+	sum.manager = m
+	sum.fileDetails.resume = make(map[int64]resume)
+	sum.retryPolicy = defaultRetryPolicy()
+	sum.ctx = ctx
+	sum.httpClient = m.client
+	sum.RWMutex = &sync.RWMutex{}
+	sum.progressBar.RWMutex = &sync.RWMutex{}
+	sum.progressBar.p = make(map[int64]*progress)
+	sum.stop = make(chan error)
+	sum.separator = string(os.PathSeparator)
+
+	// Relay the Manager-wide shutdown broadcast onto this file's own stop
+	// channel. m.stop is closed exactly once but read from by every chunk
+	// goroutine of every file; closing sum.stop here re-broadcasts that to
+	// every chunk goroutine of this file specifically, rather than a single
+	// send being consumed by whichever one of them happens to be selecting
+	// on it first.
+	go func() {
+		<-m.stop
+		close(sum.stop)
+	}()
+
+	sum.setConcurrency(int64(m.opts.MaxConcurrency))
+
+	if err := sum.setAbsolutePath(entry.OutputPath); err != nil {
+		return nil, fmt.Errorf("error setting output path for %s : %v", entry.URL, err)
+	}
+	sum.setFileDir()
+
+	if err := sum.createTempOutputFile(); err != nil {
+		return nil, err
+	}
+
+	return sum, nil
+}
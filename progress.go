@@ -1,8 +1,10 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"math"
+	"os"
 	"strings"
 	"sync"
 	"time"
@@ -20,41 +22,146 @@ type progress struct {
 
 var progressSize int
 
+// noProgress turns off the ANSI redraw entirely - both the per-connection
+// bars and the aggregate Total line - and falls back to one log line per
+// tick. It's also forced on automatically when stdout isn't a TTY, since
+// cursor-up redraws just produce garbage in a CI log.
+var noProgress = flag.Bool("no-progress", false, "disable the progress bar and log plain per-tick lines instead (auto-disabled when stdout is not a terminal)")
+
+// throughputEMA weights how much an aggregate reading's tick-to-tick
+// instantaneous throughput moves the running average: higher reacts
+// faster to bursts, lower smooths them out.
+const throughputEMA = 0.3
+
 func (sum *summon) startProgressBar(wg *sync.WaitGroup, stop chan struct{}) {
 
 	defer wg.Done()
 
+	if *noProgress || !isTerminal(os.Stdout) {
+		sum.logProgress(stop)
+		return
+	}
+
 	ticker := time.NewTicker(time.Second)
 	defer ticker.Stop()
 
+	agg := &aggregateProgress{}
+
 	for {
 		select {
 		case <-ticker.C:
-			for i := int64(0); i < int64(len(sum.progressBar.p)); i++ {
+			total := sum.renderConnections()
+			agg.tick(total)
+			printTotalProgress(*agg)
 
-				sum.progressBar.RLock()
-				p := *sum.progressBar.p[i]
-				sum.progressBar.RUnlock()
-
-				printProgress(i, p)
-			}
-
-			// Move cursor back
-			for i := 0; i < len(sum.progressBar.p); i++ {
+			// Move cursor back up over every connection line plus the Total line.
+			for i := 0; i < len(sum.progressBar.p)+1; i++ {
 				fmt.Print("\033[F")
 			}
 
 		case <-stop:
+			total := sum.renderConnections()
+			agg.tick(total)
+			printTotalProgress(*agg)
+			return
+		}
+	}
+
+}
+
+// renderConnections prints every chunk's bar and returns the total bytes
+// read and expected across all of them, for the aggregate line.
+func (sum *summon) renderConnections() progress {
+	total := progress{}
+
+	for i := int64(0); i < int64(len(sum.progressBar.p)); i++ {
+		sum.progressBar.RLock()
+		p := *sum.progressBar.p[i]
+		sum.progressBar.RUnlock()
+
+		printProgress(i, p)
+
+		total.curr += p.curr
+		total.total += p.total
+	}
+
+	return total
+}
+
+// logProgress is the --no-progress / non-TTY fallback: one plain log line
+// per tick instead of an ANSI redraw, so the tool stays readable in a CI
+// log rather than filling it with cursor-control garbage.
+func (sum *summon) logProgress(stop chan struct{}) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	agg := &aggregateProgress{}
+
+	for {
+		select {
+		case <-ticker.C:
+			total := progress{}
 			for i := int64(0); i < int64(len(sum.progressBar.p)); i++ {
 				sum.progressBar.RLock()
 				p := *sum.progressBar.p[i]
 				sum.progressBar.RUnlock()
-				printProgress(i, p)
+				total.curr += p.curr
+				total.total += p.total
 			}
+
+			agg.tick(total)
+			logTotalProgress(*agg)
+
+		case <-stop:
 			return
 		}
 	}
+}
 
+// aggregateProgress tracks the running Total bar's state across ticks:
+// last reading and when it was taken, so throughput can be derived from the
+// delta between this tick and the last without any extra locking - it's
+// only ever touched from the single goroutine driving the progress loop.
+type aggregateProgress struct {
+	curr, total int64
+	bytesPerSec float64
+	lastCurr    int64
+	lastTick    time.Time
+	started     bool
+}
+
+// tick folds in a fresh aggregate reading, updating the EMA throughput from
+// the delta against the previous tick.
+func (a *aggregateProgress) tick(p progress) {
+	now := time.Now()
+
+	if a.started {
+		elapsed := now.Sub(a.lastTick).Seconds()
+		if elapsed > 0 {
+			instant := float64(p.curr-a.lastCurr) / elapsed
+			a.bytesPerSec = throughputEMA*instant + (1-throughputEMA)*a.bytesPerSec
+		}
+	} else {
+		a.started = true
+	}
+
+	a.curr, a.total = p.curr, p.total
+	a.lastCurr, a.lastTick = p.curr, now
+}
+
+// eta estimates time remaining at the current EMA throughput, or zero if
+// there isn't a meaningful rate yet.
+func (a *aggregateProgress) eta() time.Duration {
+	if a.bytesPerSec <= 0 {
+		return 0
+	}
+
+	remaining := a.total - a.curr
+	if remaining <= 0 {
+		return 0
+	}
+
+	return time.Duration(float64(remaining)/a.bytesPerSec) * time.Second
 }
 
 func printProgress(index int64, p progress) {
@@ -78,3 +185,34 @@ func printProgress(index int64, p progress) {
 
 	fmt.Printf("Connection %d  - %s\n", index+1, s.String())
 }
+
+// printTotalProgress renders the aggregate "Total" bar below the
+// per-connection ones: overall percent, human-readable bytes, throughput
+// and ETA.
+func printTotalProgress(a aggregateProgress) {
+	percent := math.Round((float64(a.curr) / float64(a.total)) * 100)
+
+	fmt.Printf("Total          - %.0f%% (%s / %s) %s eta %s\n",
+		percent, humanizeBytes(a.curr), humanizeBytes(a.total), humanizeSpeed(a.bytesPerSec), humanizeETA(a.eta()))
+}
+
+// logTotalProgress is printTotalProgress's plain-log-line counterpart for
+// the --no-progress / non-TTY path.
+func logTotalProgress(a aggregateProgress) {
+	percent := math.Round((float64(a.curr) / float64(a.total)) * 100)
+
+	LogWriter.Printf("Total - %.0f%% (%s / %s) %s eta %s",
+		percent, humanizeBytes(a.curr), humanizeBytes(a.total), humanizeSpeed(a.bytesPerSec), humanizeETA(a.eta()))
+}
+
+// isTerminal reports whether f looks like an interactive terminal rather
+// than a pipe or redirected-to-file CI log, so the ANSI cursor-up redraw is
+// only attempted somewhere it'll actually render sensibly.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// resume tracks one chunk's range plan and how much of it has already been
+// written to the output file. It's the unit both fresh chunk planning and
+// sidecar-driven resume operate on, and what gets persisted to the resume
+// sidecar.
+type resume struct {
+	start   int64
+	end     int64
+	written int64
+}
+
+// sidecarState is the on-disk shape of the resume sidecar file we persist
+// next to the output file, so a crashed or Ctrl-C'd download can resume
+// without starting over.
+type sidecarState struct {
+	URL           string                 `json:"url"`
+	ETag          string                 `json:"etag"`
+	LastModified  string                 `json:"last_modified"`
+	ContentLength int64                  `json:"content_length"`
+	Chunks        map[int64]sidecarChunk `json:"chunk_ranges"`
+}
+
+// sidecarChunk is the on-disk form of a resume. resume's own fields are
+// unexported, which encoding/json would silently write out as {}.
+type sidecarChunk struct {
+	Start   int64 `json:"start"`
+	End     int64 `json:"end"`
+	Written int64 `json:"written"`
+}
+
+// sidecarPath returns where the resume sidecar for this download lives,
+// next to the output file.
+func (sum *summon) sidecarPath() string {
+	return sum.fileDetails.fileDir + sum.separator + "." + sum.fileDetails.fileName + ".sumresume.json"
+}
+
+// saveResumeState snapshots the current chunk plan + progress to the
+// sidecar file and fsyncs it, so a crash leaves a consistent, resumable
+// file behind rather than a half-written one.
+func (sum *summon) saveResumeState() error {
+	sum.RLock()
+	state := sidecarState{
+		URL:           sum.uri,
+		ETag:          sum.fileDetails.etag,
+		LastModified:  sum.fileDetails.lastModified,
+		ContentLength: sum.fileDetails.contentLength,
+		Chunks:        make(map[int64]sidecarChunk, len(sum.fileDetails.resume)),
+	}
+	for i, r := range sum.fileDetails.resume {
+		state.Chunks[i] = sidecarChunk{Start: r.start, End: r.end, Written: r.written}
+	}
+	sum.RUnlock()
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("error marshalling resume state : %v", err)
+	}
+
+	f, err := os.OpenFile(sum.sidecarPath(), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening resume sidecar : %v", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(data); err != nil {
+		return fmt.Errorf("error writing resume sidecar : %v", err)
+	}
+
+	return f.Sync()
+}
+
+// loadResumeState reads a previously persisted sidecar, if one exists. A
+// missing sidecar is not an error - it just means there's nothing to
+// resume.
+func loadResumeState(path string) (*sidecarState, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading resume sidecar : %v", err)
+	}
+
+	var state sidecarState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("error parsing resume sidecar : %v", err)
+	}
+
+	return &state, nil
+}
+
+// removeSidecar deletes the resume sidecar once a download has completed
+// successfully; there's nothing left to resume.
+func (sum *summon) removeSidecar() error {
+	err := os.Remove(sum.sidecarPath())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// autosaveResumeState persists the resume sidecar every few seconds until
+// stop is closed, so a download survives a crash and not just a clean
+// Ctrl-C.
+func (sum *summon) autosaveResumeState(stop chan struct{}) {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := sum.saveResumeState(); err != nil {
+				LogWriter.Printf("error autosaving resume state : %v", err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// resumeFromSidecar re-issues a HEAD for sum.uri and compares it against a
+// previously persisted sidecar. If the server's content length and
+// ETag/Last-Modified still match, it restores the chunk plan so each chunk
+// resumes from start+written instead of from zero; otherwise it aborts with
+// a clear error rather than silently resuming into a file that has since
+// changed on the server.
+func (sum *summon) resumeFromSidecar(state *sidecarState) error {
+	supportsRange, contentLength, _, etag, lastModified, err := getRangeDetails(sum.uri)
+	if err != nil {
+		return fmt.Errorf("error re-checking remote file for resume : %v", err)
+	}
+
+	if !supportsRange {
+		return fmt.Errorf("cannot resume : server no longer supports range requests")
+	}
+
+	if contentLength != state.ContentLength {
+		return fmt.Errorf("cannot resume : content length changed from %d to %d", state.ContentLength, contentLength)
+	}
+
+	if (etag != "" && state.ETag != "" && etag != state.ETag) ||
+		(lastModified != "" && state.LastModified != "" && lastModified != state.LastModified) {
+		return fmt.Errorf("cannot resume : remote file has changed since the download started")
+	}
+
+	sum.fileDetails.contentLength = contentLength
+	sum.fileDetails.etag = etag
+	sum.fileDetails.lastModified = lastModified
+	sum.fileDetails.resume = make(map[int64]resume, len(state.Chunks))
+	for i, r := range state.Chunks {
+		sum.fileDetails.resume[i] = resume{start: r.Start, end: r.End, written: r.Written}
+	}
+
+	sum.isResume = true
+	sum.isRangeSupported = true
+
+	return nil
+}
+
+// preallocateOutputFile truncates the (sparse) output file up front to the
+// full content length, so every chunk can WriteAt its own range
+// independently without any of them needing to grow the file first.
+func (sum *summon) preallocateOutputFile() error {
+	if err := sum.fileDetails.tempOutFile.Truncate(sum.fileDetails.contentLength); err != nil {
+		return fmt.Errorf("error preallocating output file : %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// RetryPolicy controls how a failed chunk request is retried: how many
+// times, how long to back off between attempts, and which failures are
+// even worth retrying in the first place.
+type RetryPolicy struct {
+	MaxAttempts int                              // give up after this many tries, including the first
+	BaseDelay   time.Duration                    // backoff before the first retry
+	MaxDelay    time.Duration                    // backoff is capped here no matter how many attempts have failed
+	RetryOn     func(*http.Response, error) bool // decides whether a given failure is worth retrying
+}
+
+// defaultRetryPolicy is what every summon gets unless overridden: 5
+// attempts, exponential backoff from 1s up to 30s, and defaultRetryOn's
+// judgment of which failures to retry.
+func defaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 5,
+		BaseDelay:   time.Second,
+		MaxDelay:    30 * time.Second,
+		RetryOn:     defaultRetryOn,
+	}
+}
+
+// defaultRetryOn retries network errors and 5xx/408/429 responses, but
+// gives up immediately on any other 4xx - those won't succeed no matter how
+// many times we ask.
+func defaultRetryOn(response *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+
+	if response.StatusCode == http.StatusRequestTimeout || response.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+
+	return response.StatusCode < 400 || response.StatusCode >= 500
+}
+
+// retryDelay computes the backoff before retrying attempt (0-indexed),
+// doubling each time off policy.BaseDelay, capped at policy.MaxDelay, with
+// up to 50% jitter so a burst of chunks failing together don't all retry in
+// lockstep.
+func retryDelay(policy RetryPolicy, attempt int) time.Duration {
+	delay := policy.BaseDelay * time.Duration(1<<uint(attempt))
+	if delay > policy.MaxDelay || delay <= 0 {
+		delay = policy.MaxDelay
+	}
+
+	jitter := time.Duration(rand.Int63n(int64(delay)/2 + 1))
+
+	return delay/2 + jitter
+}
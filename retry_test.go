@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestDefaultRetryOn(t *testing.T) {
+	cases := []struct {
+		name     string
+		response *http.Response
+		err      error
+		want     bool
+	}{
+		{"transport error", nil, errors.New("connection reset"), true},
+		{"200 no error", &http.Response{StatusCode: 200}, nil, true},
+		{"408 request timeout", &http.Response{StatusCode: http.StatusRequestTimeout}, nil, true},
+		{"429 too many requests", &http.Response{StatusCode: http.StatusTooManyRequests}, nil, true},
+		{"500 internal server error", &http.Response{StatusCode: 500}, nil, true},
+		{"503 service unavailable", &http.Response{StatusCode: 503}, nil, true},
+		{"404 not found", &http.Response{StatusCode: 404}, nil, false},
+		{"403 forbidden", &http.Response{StatusCode: 403}, nil, false},
+		{"400 bad request", &http.Response{StatusCode: 400}, nil, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := defaultRetryOn(c.response, c.err); got != c.want {
+				t.Errorf("defaultRetryOn(%+v, %v) = %v, want %v", c.response, c.err, got, c.want)
+			}
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	policy := RetryPolicy{
+		MaxAttempts: 5,
+		BaseDelay:   time.Second,
+		MaxDelay:    30 * time.Second,
+	}
+
+	for attempt := 0; attempt < policy.MaxAttempts; attempt++ {
+		delay := retryDelay(policy, attempt)
+		if delay <= 0 {
+			t.Errorf("retryDelay(attempt=%d) = %v, want > 0", attempt, delay)
+		}
+		if delay > policy.MaxDelay {
+			t.Errorf("retryDelay(attempt=%d) = %v, want <= MaxDelay %v", attempt, delay, policy.MaxDelay)
+		}
+	}
+
+	// A runaway attempt count shouldn't overflow past MaxDelay.
+	if delay := retryDelay(policy, 63); delay > policy.MaxDelay {
+		t.Errorf("retryDelay(attempt=63) = %v, want <= MaxDelay %v", delay, policy.MaxDelay)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// streamPollInterval is how often a sparseFileReader rechecks the write
+// frontier while it's waiting on a chunk that hasn't caught up to it yet.
+const streamPollInterval = 50 * time.Millisecond
+
+// Stream returns an io.ReadCloser over the output file's bytes in order,
+// usable as soon as HEAD + range planning have populated
+// sum.fileDetails.resume - it does not wait for process()'s wg.Wait(). Each
+// chunk writes its own range into the pre-allocated output file via
+// WriteAt, so Stream tails that file instead of buffering chunks in
+// memory: Read blocks until the bytes it's about to return have actually
+// landed on disk, letting a caller - stdout, a tar extractor, a hash
+// verifier - consume chunk 0 while later chunks are still being fetched.
+func (sum *summon) Stream() (io.ReadCloser, error) {
+	f, err := os.Open(sum.fileDetails.tempOutFile.Name())
+	if err != nil {
+		return nil, fmt.Errorf("error opening output file for streaming : %v", err)
+	}
+
+	return &sparseFileReader{sum: sum, file: f}, nil
+}
+
+// sparseFileReader reads a summon's sparse output file in file order,
+// blocking until the bytes it's about to return have actually been written
+// by some chunk's WriteAt rather than reading ahead into zeroed,
+// not-yet-downloaded space.
+type sparseFileReader struct {
+	sum    *summon
+	file   *os.File
+	offset int64
+}
+
+func (r *sparseFileReader) Read(p []byte) (int, error) {
+	for {
+		r.sum.RLock()
+		err := r.sum.err
+		r.sum.RUnlock()
+		if err != nil {
+			return 0, err
+		}
+
+		frontier := r.sum.writeFrontier()
+
+		if r.offset < frontier {
+			max := frontier - r.offset
+			if int64(len(p)) < max {
+				max = int64(len(p))
+			}
+
+			n, rerr := r.file.ReadAt(p[:max], r.offset)
+			r.offset += int64(n)
+			if rerr != nil && rerr != io.EOF {
+				return n, rerr
+			}
+
+			return n, nil
+		}
+
+		if r.offset >= r.sum.fileDetails.contentLength {
+			return 0, io.EOF
+		}
+
+		select {
+		case <-time.After(streamPollInterval):
+		case <-r.sum.stop:
+			return 0, ErrGracefulShutdown
+		}
+	}
+}
+
+func (r *sparseFileReader) Close() error {
+	return r.file.Close()
+}
+
+// writeFrontier returns how many bytes, counted from the start of the
+// file, have been written contiguously so far. Chunks are planned as
+// contiguous, ordered ranges and each one writes its own bytes strictly in
+// increasing offset order (see readBody), so the frontier is just the
+// chunks in start order, summing written bytes until the first one that
+// isn't yet complete.
+func (sum *summon) writeFrontier() int64 {
+	sum.RLock()
+	chunks := make([]resume, 0, len(sum.fileDetails.resume))
+	for _, c := range sum.fileDetails.resume {
+		chunks = append(chunks, c)
+	}
+	sum.RUnlock()
+
+	sort.Slice(chunks, func(i, j int) bool { return chunks[i].start < chunks[j].start })
+
+	frontier := int64(0)
+	for _, c := range chunks {
+		if c.start != frontier {
+			break
+		}
+
+		frontier += c.written
+
+		if c.written < c.end-c.start+1 {
+			break
+		}
+	}
+
+	return frontier
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+func newTestSummon(resume map[int64]resume) *summon {
+	sum := new(summon)
+	sum.RWMutex = &sync.RWMutex{}
+	sum.fileDetails.resume = resume
+	return sum
+}
+
+func TestWriteFrontier(t *testing.T) {
+	cases := []struct {
+		name   string
+		resume map[int64]resume
+		want   int64
+	}{
+		{
+			name: "all chunks complete",
+			resume: map[int64]resume{
+				0: {start: 0, end: 9, written: 10},
+				1: {start: 10, end: 19, written: 10},
+			},
+			want: 20,
+		},
+		{
+			name: "first chunk still in progress",
+			resume: map[int64]resume{
+				0: {start: 0, end: 9, written: 4},
+				1: {start: 10, end: 19, written: 10},
+			},
+			want: 4,
+		},
+		{
+			name: "later chunk ahead of an earlier gap",
+			resume: map[int64]resume{
+				0: {start: 0, end: 9, written: 0},
+				1: {start: 10, end: 19, written: 10},
+			},
+			want: 0,
+		},
+		{
+			name: "middle chunk incomplete stops the frontier there",
+			resume: map[int64]resume{
+				0: {start: 0, end: 9, written: 10},
+				1: {start: 10, end: 19, written: 5},
+				2: {start: 20, end: 29, written: 10},
+			},
+			want: 15,
+		},
+		{
+			name:   "no chunks planned yet",
+			resume: map[int64]resume{},
+			want:   0,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			sum := newTestSummon(c.resume)
+			if got := sum.writeFrontier(); got != c.want {
+				t.Errorf("writeFrontier() = %d, want %d", got, c.want)
+			}
+		})
+	}
+}
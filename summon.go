@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"io"
@@ -18,28 +19,43 @@ import (
 type downloader func(wg *sync.WaitGroup) error
 
 type summon struct {
-	concurrency      int64       // No. of connections
-	uri              string      // URL of the file we want to download
-	isResume         bool        // is this a resume request
-	isRangeSupported bool        // if this request supports range
-	err              error       // used when error occurs inside a goroutine
-	startTime        time.Time   // to track time took
-	fileDetails      fileDetails // will hold the file related details
-	metaData         meta        // Will hold the meta data of the range and file details
-	progressBar      progressBar // index => progress
-	stop             chan error  // to handle stop signals from terminal
-	separator        string      // store the path separator based on the OS
-	*sync.RWMutex                // mutex to lock the maps which accessing it concurrently
+	concurrency      int64          // No. of connections
+	uri              string         // URL of the file we want to download
+	isResume         bool           // is this a resume request
+	isRangeSupported bool           // if this request supports range
+	err              error          // used when error occurs inside a goroutine
+	startTime        time.Time      // to track time took
+	fileDetails      fileDetails    // will hold the file related details
+	metaData         meta           // Will hold the meta data of the range and file details
+	progressBar      progressBar    // index => progress
+	stop             chan error     // to handle stop signals from terminal
+	separator        string         // store the path separator based on the OS
+	sem              chan struct{}  // bounds in-flight range requests to sum.concurrency
+	manager          *Manager       // set when this summon is one file of a multifile download, sharing its budget
+	checksum         checksumConfig // expected digest, from -checksum or the server's HEAD response
+	retryPolicy      RetryPolicy    // how a failed chunk is retried - attempts, backoff, what's worth retrying
+	ctx              context.Context // cancelled to abort in-flight range requests
+	httpClient       *http.Client    // shared across every chunk - and, for a manifest download, every file
+	*sync.RWMutex                   // mutex to lock the maps which accessing it concurrently
+}
+
+// checksumConfig is the digest we expect the downloaded bytes to hash to,
+// either supplied out-of-band via -checksum or parsed off the server's HEAD
+// response by getRangeDetails.
+type checksumConfig struct {
+	algorithm   string
+	expectedHex string
 }
 
 type fileDetails struct {
-	chunks        map[int64]*os.File // Map of part files we are creating
-	fileName      string             // name of the file we are downloading
-	fileDir       string             // dir of the file
-	absolutePath  string             // absolute path of the output file
-	tempOutFile   *os.File           // output / downloaded file
-	resume        map[int64]resume   // how much is downloaded
+	fileName      string           // name of the file we are downloading
+	fileDir       string           // dir of the file
+	absolutePath  string           // absolute path of the output file
+	tempOutFile   *os.File         // pre-allocated sparse output file; each chunk writes its own range via WriteAt
+	resume        map[int64]resume // per-chunk range plan + bytes written so far; persisted to the resume sidecar
 	contentLength int64
+	etag          string // server ETag as of the last HEAD, used to detect the remote file changing across a resume
+	lastModified  string // server Last-Modified as of the last HEAD, same purpose as etag
 }
 
 func NewSummon() (*summon, error) {
@@ -64,7 +80,6 @@ func NewSummon() (*summon, error) {
 	}
 
 	sum.uri = fileURL
-	sum.fileDetails.chunks = make(map[int64]*os.File)
 	sum.startTime = time.Now()
 	sum.fileDetails.fileName = filepath.Base(sum.uri)
 	sum.RWMutex = &sync.RWMutex{}
@@ -73,15 +88,47 @@ func NewSummon() (*summon, error) {
 	sum.stop = make(chan error)
 	sum.separator = string(os.PathSeparator)
 	sum.fileDetails.resume = make(map[int64]resume)
+	sum.retryPolicy = defaultRetryPolicy()
+	sum.ctx = context.Background()
+	sum.httpClient = &http.Client{Timeout: 0}
 
 	sum.setConcurrency(args.connections)
 	sum.setAbsolutePath(args.outputFile)
 	sum.setFileDir()
 
+	if args.checksum != "" {
+		checksum, err := parseChecksumFlag(args.checksum)
+		if err != nil {
+			return nil, err
+		}
+		sum.checksum = checksum
+	}
+
+	// sem caps in-flight range requests at sum.concurrency, even when more
+	// chunks are planned than there are workers to run them concurrently.
+	sum.sem = make(chan struct{}, int(sum.concurrency))
+
+	// A sidecar left behind by a previous, interrupted run of this same
+	// output file means we can resume chunk-by-chunk instead of starting
+	// over - see resumeFromSidecar.
+	if state, err := loadResumeState(sum.sidecarPath()); err != nil {
+		return nil, err
+	} else if state != nil {
+		if err := sum.resumeFromSidecar(state); err != nil {
+			return nil, err
+		}
+	}
+
 	if err := sum.createTempOutputFile(); err != nil {
 		return nil, err
 	}
 
+	if sum.fileDetails.contentLength > 0 {
+		if err := sum.preallocateOutputFile(); err != nil {
+			return nil, err
+		}
+	}
+
 	return sum, nil
 }
 
@@ -110,18 +157,32 @@ func (sum *summon) process() error {
 		return err
 	}
 
+	// Each chunk writes its own range directly into the pre-allocated output
+	// file via WriteAt, so autosave the resume sidecar alongside them in
+	// case we crash before they finish.
+	stopAutosave := make(chan struct{})
+	go sum.autosaveResumeState(stopAutosave)
+
 	stop := make(chan struct{})
 
 	pWg.Add(1)
 	// Keep Printing Progress
 	go sum.startProgressBar(pWg, stop)
+
+	// Hash the bytes as they land rather than waiting for every chunk to
+	// finish and re-reading the file afterwards: streamChecksum consumes
+	// sum.Stream() concurrently with the downloads below, so most of the
+	// hashing overlaps them; the result is waited for further down.
+	var checksumResult <-chan error
+	if sum.checksum.algorithm != "" {
+		checksumResult = sum.streamChecksum()
+	}
+
 	wg.Wait()
+	close(stopAutosave)
 
 	// Defer file closing
 	defer sum.fileDetails.tempOutFile.Close()
-	for _, f := range sum.fileDetails.chunks {
-		defer f.Close()
-	}
 
 	stop <- struct{}{}
 
@@ -132,7 +193,26 @@ func (sum *summon) process() error {
 		return sum.err
 	}
 
-	return sum.combineChunks()
+	if checksumResult != nil {
+		if err := <-checksumResult; err != nil {
+			os.Remove(sum.fileDetails.tempOutFile.Name())
+			// The output file is gone, so the sidecar's per-chunk written
+			// counts no longer describe anything real - leaving it behind
+			// would let a later run resumeFromSidecar() against a file that
+			// no longer exists.
+			if rmErr := sum.removeSidecar(); rmErr != nil {
+				LogWriter.Printf("error removing resume sidecar : %v", rmErr)
+			}
+			return err
+		}
+		LogWriter.Printf("Checksum verified : %s", sum.checksum.algorithm)
+	}
+
+	if err := sum.removeSidecar(); err != nil {
+		LogWriter.Printf("error removing resume sidecar : %v", err)
+	}
+
+	return sum.finalizeOutputFile()
 }
 
 // The reason for this type is that our download & resumeDownload have the same method definition.  We have also created  getDownloader method which returns a downloader.
@@ -144,10 +224,6 @@ func (sum *summon) getDownloader() downloader {
 	return sum.download
 }
 
-func (sum summon) getTempFileName(index, start, end int64) (string, error) {
-	return fmt.Sprintf("%s%s.%s.sump%d", sum.fileDetails.fileDir, sum.separator, sum.fileDetails.fileName, index), nil
-}
-
 // setConcurrency set the concurrency as per min and max
 func (sum *summon) setConcurrency(c int64) {
 	// We use default connections in case no concurrency is passed
@@ -205,33 +281,14 @@ func (sum *summon) setFileDir() {
 	sum.fileDetails.fileDir = filepath.Dir(sum.fileDetails.absolutePath)
 }
 
-// combineChunks will combine the chunks in ordered fashion starting from 1
-func (sum *summon) combineChunks() error {
-	LogWriter.Printf("Combining the files...")
-
-	var w int64
-	// maps are not ordered hence using for loop
-	for i := int64(0); i < int64(len(sum.fileDetails.chunks)); i++ {
-		handle := sum.fileDetails.chunks[i]
-
-		if handle == nil {
-			return fmt.Errorf("got chunk handle nil")
-		}
-
-		handle.Seek(0, 0) // We need to seek because read and write cursor are same and the cursor would be at the end.
-		written, err := io.Copy(sum.fileDetails.tempOutFile, handle)
-		if err != nil {
-			return fmt.Errorf("error occured while copying to temp file : %v", err)
-		}
-		w += written
-	}
-
+// finalizeOutputFile renames the temp output file to its final name. Every
+// chunk already wrote its bytes straight to its own offset in that file via
+// WriteAt, so there is no combine pass left to do here.
+func (sum *summon) finalizeOutputFile() error {
 	tempFileName := sum.fileDetails.tempOutFile.Name()
 
 	finalFileName := sum.fileDetails.fileDir + sum.separator + sum.fileDetails.fileName
 
-	log.Printf("Wrote to File : %v, Written : %v", finalFileName, humanSizeFromBytes(w))
-
 	LogWriter.Printf("Renaming File from : %v to %v", tempFileName, finalFileName)
 
 	if err := os.Rename(tempFileName, finalFileName); err != nil {
@@ -241,78 +298,149 @@ func (sum *summon) combineChunks() error {
 	return nil
 }
 
-// downloadFileForRange will download the file for the provided range and set the bytes to the chunk map, will set summor.error field if error occurs
-func (sum *summon) downloadFileForRange(wg *sync.WaitGroup, r string, index int64, handle io.Writer) {
-	LogWriter.Printf("Downloading for range : %s , for index : %d", r, index)
+// downloadFileForRange downloads the provided chunk, retrying a failed
+// attempt per sum.retryPolicy instead of giving up on the first error. Each
+// attempt - the first try or a later retry alike - starts from
+// sum.fileDetails.resume[index].written rather than from zero, so it picks
+// up whatever bytes the previous attempt already got onto disk instead of
+// re-downloading them; this is the same offset bookkeeping the resume
+// feature uses across a restart.
+func (sum *summon) downloadFileForRange(wg *sync.WaitGroup, index int64) {
 	defer wg.Done()
 
-	request, err := http.NewRequest("GET", sum.uri, strings.NewReader(""))
-	if err != nil {
-		sum.Lock()
-		sum.err = err
-		sum.Unlock()
-		return
+	policy := sum.retryPolicy
+
+	for attempt := 0; ; attempt++ {
+		ok, response, err := sum.attemptChunkDownload(index)
+		if ok {
+			return
+		}
+
+		failErr := err
+		if failErr == nil {
+			failErr = fmt.Errorf("did not get 20X status code, got : %v", response.StatusCode)
+		}
+
+		retryable := attempt < policy.MaxAttempts-1 && policy.RetryOn(response, err)
+		if !retryable {
+			sum.Lock()
+			sum.err = failErr
+			sum.Unlock()
+			log.Println(failErr)
+			return
+		}
+
+		delay := retryDelay(policy, attempt)
+		LogWriter.Printf("chunk %d failed (attempt %d/%d), retrying in %v : %v", index, attempt+1, policy.MaxAttempts, delay, failErr)
+
+		select {
+		case <-time.After(delay):
+		case <-sum.stop:
+			sum.Lock()
+			sum.err = ErrGracefulShutdown
+			sum.Unlock()
+			return
+		}
+	}
+}
+
+// attemptChunkDownload makes a single GET attempt for the given chunk,
+// ranged from start+written so a retry resumes rather than restarts. ok is
+// true only on a fully successful attempt. response is returned whenever we
+// got one at all - even on a non-2xx status, with a nil err, exactly like
+// normal http.Client/Response semantics - so RetryPolicy.RetryOn can tell a
+// permanent 4xx from a retryable 5xx by status code alone, instead of
+// downloadFileForRange having already collapsed every non-2xx into a
+// synthetic error that RetryOn's "err != nil" check would always retry.
+func (sum *summon) attemptChunkDownload(index int64) (ok bool, response *http.Response, err error) {
+	sum.RLock()
+	r := sum.fileDetails.resume[index]
+	sum.RUnlock()
+
+	start := r.start + r.written
+	rangeHeader := fmt.Sprintf("%d-%d", start, r.end)
+
+	LogWriter.Printf("Downloading for range : %s , for index : %d", rangeHeader, index)
+
+	// Block until a slot frees up so planned chunks beyond sum.concurrency
+	// don't all dial out at once. A summon that's part of a manifest
+	// download instead draws from the Manager's global budget, shared
+	// across every file in the manifest. The slot is released before we
+	// return, so a chunk sleeping out a retry backoff doesn't hold it idle.
+	if sum.manager != nil {
+		if err := sum.manager.sem.Acquire(context.Background(), 1); err != nil {
+			return false, nil, err
+		}
+		defer sum.manager.sem.Release(1)
+	} else {
+		sum.sem <- struct{}{}
+		defer func() { <-sum.sem }()
 	}
 
-	request.Header.Add("Range", "bytes="+r)
+	request, err := http.NewRequestWithContext(sum.ctx, "GET", sum.uri, strings.NewReader(""))
+	if err != nil {
+		return false, nil, err
+	}
 
-	client := http.Client{Timeout: 0}
+	request.Header.Add("Range", "bytes="+rangeHeader)
 
-	response, err := client.Do(request)
+	response, err = sum.httpClient.Do(request)
 	if err != nil {
-		sum.Lock()
-		sum.err = err
-		sum.Unlock()
-		return
+		return false, nil, err
 	}
+	defer response.Body.Close()
 
 	// 206 = Partial Content
 	if response.StatusCode != 200 && response.StatusCode != 206 {
-		sum.Lock()
-		sum.err = fmt.Errorf("did not get 20X status code, got : %v", response.StatusCode)
-		sum.Unlock()
-		log.Println(sum.err)
-		return
+		return false, response, nil
 	}
 
-	if err := sum.getDataAndWriteToFile(response.Body, handle, index); err != nil {
-		sum.Lock()
-		sum.err = err
-		sum.Unlock()
-		log.Println(sum.err)
-		return
+	if err := sum.getDataAndWriteToFile(response.Body, index, start); err != nil {
+		return false, response, err
 	}
+
+	return true, response, nil
 }
 
-// getRangeDetails returns ifRangeIsSupported,statuscode,error
-func getRangeDetails(u string) (bool, int64, error) {
+// getRangeDetails returns ifRangeIsSupported,contentLength,digest,etag,lastModified,error.
+// digest is the integrity digest the server advertised on the HEAD response,
+// if any - see serverDigest. etag/lastModified let a resume detect the
+// remote file changing underneath it.
+func getRangeDetails(u string) (bool, int64, checksumConfig, string, string, error) {
 	request, err := http.NewRequest("HEAD", u, strings.NewReader(""))
 	if err != nil {
-		return false, 0, fmt.Errorf("error while creating request : %v", err)
+		return false, 0, checksumConfig{}, "", "", fmt.Errorf("error while creating request : %v", err)
 	}
 
 	sc, headers, _, err := doAPICall(request)
 	if err != nil {
-		return false, 0, fmt.Errorf("error calling url : %v", err)
+		return false, 0, checksumConfig{}, "", "", fmt.Errorf("error calling url : %v", err)
 	}
 
 	if sc != 200 && sc != 206 {
-		return false, 0, fmt.Errorf("did not get 200 or 206 response")
+		return false, 0, checksumConfig{}, "", "", fmt.Errorf("did not get 200 or 206 response")
 	}
 
 	conLen := headers.Get("Content-Length")
 
 	cl, err := parseint64(conLen)
 	if err != nil {
-		return false, 0, fmt.Errorf("error Parsing content length : %v", err)
+		return false, 0, checksumConfig{}, "", "", fmt.Errorf("error Parsing content length : %v", err)
+	}
+
+	var digest checksumConfig
+	if algorithm, expectedHex, ok := serverDigest(headers); ok {
+		digest = checksumConfig{algorithm: algorithm, expectedHex: expectedHex}
 	}
 
+	etag, lastModified := headers.Get("ETag"), headers.Get("Last-Modified")
+
 	// Accept-Ranges: bytes
 	if headers.Get("Accept-Ranges") == "bytes" {
-		return true, cl[0], nil
+		return true, cl[0], digest, etag, lastModified, nil
 	}
 
-	return false, cl[0], nil
+	return false, cl[0], digest, etag, lastModified, nil
 }
 
 // doAPICall will do the api call and return statuscode,headers,data,error respectively
@@ -367,13 +495,16 @@ func getFileNameFromHeaders(u string) (string, error) {
 	return params["filename"], nil
 }
 
-// getDataAndWriteToFile will get the response and write to file
-func (sum *summon) getDataAndWriteToFile(body io.ReadCloser, f io.Writer, index int64) error {
+// getDataAndWriteToFile will get the response and WriteAt it into the
+// output file at the chunk's running offset, starting from start.
+func (sum *summon) getDataAndWriteToFile(body io.ReadCloser, index, start int64) error {
 	defer body.Close()
 
 	// we make buffer of 500 bytes and try to read 500 bytes every iteration.
 	var buf = make([]byte, 500)
 
+	offset := start
+
 	defer startTimer("Time took for chunk : %v is", index)()
 
 	for {
@@ -381,7 +512,9 @@ func (sum *summon) getDataAndWriteToFile(body io.ReadCloser, f io.Writer, index
 		case <-sum.stop:
 			return ErrGracefulShutdown
 		default:
-			err := sum.readBody(body, f, buf, index)
+			n, err := sum.readBody(body, offset, buf, index)
+			offset += int64(n)
+
 			if err == io.EOF {
 				return nil
 			}
@@ -393,11 +526,19 @@ func (sum *summon) getDataAndWriteToFile(body io.ReadCloser, f io.Writer, index
 	}
 }
 
-func (sum *summon) readBody(body io.Reader, f io.Writer, buf []byte, index int64) error {
+func (sum *summon) readBody(body io.Reader, offset int64, buf []byte, index int64) (int, error) {
 	r, err := body.Read(buf)
 
 	if r > 0 {
-		f.Write(buf[:r])
+		if _, werr := sum.fileDetails.tempOutFile.WriteAt(buf[:r], offset); werr != nil {
+			return r, werr
+		}
+
+		sum.Lock()
+		chunk := sum.fileDetails.resume[index]
+		chunk.written += int64(r)
+		sum.fileDetails.resume[index] = chunk
+		sum.Unlock()
 
 		sum.progressBar.Lock()
 		sum.progressBar.p[index].curr += int64(r)
@@ -405,8 +546,8 @@ func (sum *summon) readBody(body io.Reader, f io.Writer, buf []byte, index int64
 	}
 
 	if err != nil {
-		return err
+		return r, err
 	}
 
-	return nil
+	return r, nil
 }